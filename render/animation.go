@@ -0,0 +1,210 @@
+/*
+Copyright (c) 2017 Lauris Bukšis-Haberkorns <lauris@nix.lv>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/kettek/apng"
+)
+
+// PaletteMode selects how SaveAsAnimatedGif builds the color palette used to
+// quantize frames.
+type PaletteMode int
+
+const (
+	// GlobalPalette computes a single palette shared by every frame. It is
+	// quantized once up front, so it is far cheaper than PerFramePalette at
+	// the cost of some color accuracy on frames that differ a lot.
+	GlobalPalette PaletteMode = iota
+	// PerFramePalette computes a dedicated palette for every frame. It looks
+	// better on maps whose animations cycle through very different colors,
+	// but costs a full quantization pass per frame.
+	PerFramePalette
+)
+
+// AnimationOptions configures SaveAsAnimatedGif and SaveAsAnimatedPng.
+type AnimationOptions struct {
+	// FrameDuration is the time step between sampled frames. Smaller values
+	// produce smoother animations at the cost of more frames to encode.
+	FrameDuration time.Duration
+	// Palette selects between a palette shared by all frames or one
+	// computed per frame. Only used by SaveAsAnimatedGif.
+	Palette PaletteMode
+}
+
+const defaultFrameDuration = 100 * time.Millisecond
+
+// RenderFrame returns a copy of the most recently rendered result with every
+// animated tile advanced to the frame it shows at elapsed time t, so callers
+// can drive their own animation loop (e.g. feed frames into ebiten) instead
+// of going through SaveAsAnimatedGif/SaveAsAnimatedPng.
+func (r *Renderer) RenderFrame(t time.Duration) *image.NRGBA {
+	frame := imaging.Clone(r.Result)
+	ms := uint32(t.Milliseconds())
+
+	for _, anim := range r.Animations {
+		if anim.Duration == 0 || len(anim.TileImages) == 0 {
+			continue
+		}
+
+		elapsed := ms % anim.Duration
+		idx := len(anim.TileImages) - 1
+		var acc uint32
+		for i, d := range anim.FrameDurations {
+			acc += d
+			if elapsed < acc {
+				idx = i
+				break
+			}
+		}
+
+		img := anim.TileImages[idx]
+		draw.Draw(frame, anim.TilePos, img, img.Bounds().Min, draw.Over)
+	}
+
+	return frame
+}
+
+// animationLoopDuration returns the LCM, in milliseconds, of every animated
+// tile's loop duration currently tracked by the renderer - i.e. how long it
+// takes for the whole map's animation to return to its starting state. It
+// returns 0 if the map has no animated tiles.
+func (r *Renderer) animationLoopDuration() uint32 {
+	var total uint32
+	for _, anim := range r.Animations {
+		if anim.Duration == 0 {
+			continue
+		}
+		if total == 0 {
+			total = anim.Duration
+			continue
+		}
+		total = lcm(total, anim.Duration)
+	}
+	return total
+}
+
+func gcd(a, b uint32) uint32 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func lcm(a, b uint32) uint32 {
+	return a / gcd(a, b) * b
+}
+
+// animationFrames renders one frame every opts.FrameDuration across a full
+// animation loop of the map.
+func (r *Renderer) animationFrames(opts *AnimationOptions) []*image.NRGBA {
+	step := opts.FrameDuration
+	if step <= 0 {
+		step = defaultFrameDuration
+	}
+
+	total := r.animationLoopDuration()
+
+	var frames []*image.NRGBA
+	for t := time.Duration(0); total == 0 || uint32(t.Milliseconds()) < total; t += step {
+		frames = append(frames, r.RenderFrame(t))
+		if total == 0 {
+			break
+		}
+	}
+	return frames
+}
+
+// SaveAsAnimatedGif writes the map's tile animations as a multi-frame GIF to
+// the provided writer, stepping through a full animation loop and baking in
+// the correct AnimationTile frame at each step. If the map has no animated
+// tiles it falls back to a single static frame.
+func (r *Renderer) SaveAsAnimatedGif(w io.Writer, opts *AnimationOptions) error {
+	if opts == nil {
+		opts = &AnimationOptions{}
+	}
+	step := opts.FrameDuration
+	if step <= 0 {
+		step = defaultFrameDuration
+	}
+
+	frames := r.animationFrames(opts)
+
+	var sharedPalette color.Palette
+	if opts.Palette == GlobalPalette {
+		imgs := make([]image.Image, len(frames))
+		for i, f := range frames {
+			imgs[i] = f
+		}
+		sharedPalette = quantizePalette(imgs...)
+	}
+
+	out := gif.GIF{}
+	for _, f := range frames {
+		pal := sharedPalette
+		if pal == nil {
+			pal = quantizePalette(f)
+		}
+
+		paletted := image.NewPaletted(f.Bounds(), pal)
+		draw.Draw(paletted, f.Bounds(), f, f.Bounds().Min, draw.Src)
+
+		out.Image = append(out.Image, paletted)
+		out.Delay = append(out.Delay, int(step/(10*time.Millisecond)))
+	}
+
+	return gif.EncodeAll(w, &out)
+}
+
+// SaveAsAnimatedPng writes the map's tile animations as an animated PNG
+// (APNG) to the provided writer, using the same frame sampling as
+// SaveAsAnimatedGif but without the palette quantization GIF requires.
+func (r *Renderer) SaveAsAnimatedPng(w io.Writer, opts *AnimationOptions) error {
+	if opts == nil {
+		opts = &AnimationOptions{}
+	}
+	step := opts.FrameDuration
+	if step <= 0 {
+		step = defaultFrameDuration
+	}
+
+	frames := r.animationFrames(opts)
+
+	a := apng.APNG{Frames: make([]apng.Frame, len(frames))}
+	for i, f := range frames {
+		a.Frames[i] = apng.Frame{
+			Image:            f,
+			DelayNumerator:   uint16(step.Milliseconds()),
+			DelayDenominator: 1000,
+		}
+	}
+
+	return apng.Encode(w, a)
+}
@@ -0,0 +1,227 @@
+/*
+Copyright (c) 2017 Lauris Bukšis-Haberkorns <lauris@nix.lv>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package render
+
+import (
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// BlendFunc composites src onto dst within r, the same way draw.DrawMask
+// does, but following a blend mode's own rule for combining colors instead
+// of always replacing dst with src. mask may be nil, meaning fully opaque.
+type BlendFunc func(dst *image.NRGBA, r image.Rectangle, src image.Image, sp image.Point, mask image.Image)
+
+// defaultBlendModes are the blend modes Tiled itself understands, keyed by
+// the name a layer opts into via its custom "blendmode" property.
+var defaultBlendModes = map[string]BlendFunc{
+	"normal":   blendNormal,
+	"add":      blendAdd,
+	"multiply": blendMultiply,
+	"screen":   blendScreen,
+	"lighten":  blendLighten,
+	"darken":   blendDarken,
+	"average":  blendAverage,
+}
+
+// RegisterBlendMode registers fn under name for this renderer, so a layer
+// whose BlendMode equals name is composited with fn. Registering a name
+// that already exists replaces it, including the built-in modes.
+func (r *Renderer) RegisterBlendMode(name string, fn BlendFunc) {
+	if r.blendModes == nil {
+		r.blendModes = make(map[string]BlendFunc, len(defaultBlendModes))
+		for k, v := range defaultBlendModes {
+			r.blendModes[k] = v
+		}
+	}
+	r.blendModes[name] = fn
+}
+
+// resolveBlendMode returns the BlendFunc registered for name, falling back
+// to normal compositing for an empty or unrecognized name.
+func (r *Renderer) resolveBlendMode(name string) BlendFunc {
+	if name == "" {
+		return blendNormal
+	}
+	if r.blendModes != nil {
+		if fn, ok := r.blendModes[name]; ok {
+			return fn
+		}
+	}
+	if fn, ok := defaultBlendModes[name]; ok {
+		return fn
+	}
+	return blendNormal
+}
+
+// blendWith builds a BlendFunc that combines each destination/source pixel
+// pair with combine, then alpha-composites the result over the destination
+// using the source's alpha (reduced by mask, if any) - the same alpha
+// handling RenderLayer previously did by hand for plain opacity.
+func blendWith(combine func(dst, src color.NRGBA) color.NRGBA) BlendFunc {
+	return func(dst *image.NRGBA, r image.Rectangle, src image.Image, sp image.Point, mask image.Image) {
+		dx := sp.X - r.Min.X
+		dy := sp.Y - r.Min.Y
+
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				sc := color.NRGBAModel.Convert(src.At(x+dx, y+dy)).(color.NRGBA)
+				if sc.A == 0 {
+					continue
+				}
+
+				alpha := uint32(sc.A)
+				if mask != nil {
+					_, _, _, ma := mask.At(x, y).RGBA()
+					alpha = alpha * (ma >> 8) / 255
+				}
+				if alpha == 0 {
+					continue
+				}
+
+				dc := dst.NRGBAAt(x, y)
+				blended := combine(dc, sc)
+				dst.SetNRGBA(x, y, alphaOver(dc, blended, uint8(alpha)))
+			}
+		}
+	}
+}
+
+// alphaOver linearly interpolates from dst to blended by alpha/255, the
+// usual "over" alpha composite, and accumulates destination alpha the same
+// way draw.Over does.
+func alphaOver(dst, blended color.NRGBA, alpha uint8) color.NRGBA {
+	a := uint32(alpha)
+	lerp := func(d, s uint8) uint8 {
+		return uint8((uint32(d)*(255-a) + uint32(s)*a) / 255)
+	}
+	return color.NRGBA{
+		R: lerp(dst.R, blended.R),
+		G: lerp(dst.G, blended.G),
+		B: lerp(dst.B, blended.B),
+		A: uint8(uint32(dst.A) + a*(255-uint32(dst.A))/255),
+	}
+}
+
+func addU8(a, b uint8) uint8 {
+	v := uint32(a) + uint32(b)
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
+
+func mulU8(a, b uint8) uint8 {
+	return uint8(uint32(a) * uint32(b) / 255)
+}
+
+func screenU8(a, b uint8) uint8 {
+	return 255 - mulU8(255-a, 255-b)
+}
+
+var blendNormal = blendWith(func(dst, src color.NRGBA) color.NRGBA { return src })
+
+var blendAdd = blendWith(func(dst, src color.NRGBA) color.NRGBA {
+	return color.NRGBA{R: addU8(dst.R, src.R), G: addU8(dst.G, src.G), B: addU8(dst.B, src.B), A: src.A}
+})
+
+var blendMultiply = blendWith(func(dst, src color.NRGBA) color.NRGBA {
+	return color.NRGBA{R: mulU8(dst.R, src.R), G: mulU8(dst.G, src.G), B: mulU8(dst.B, src.B), A: src.A}
+})
+
+var blendScreen = blendWith(func(dst, src color.NRGBA) color.NRGBA {
+	return color.NRGBA{R: screenU8(dst.R, src.R), G: screenU8(dst.G, src.G), B: screenU8(dst.B, src.B), A: src.A}
+})
+
+var blendLighten = blendWith(func(dst, src color.NRGBA) color.NRGBA {
+	return color.NRGBA{R: maxU8(dst.R, src.R), G: maxU8(dst.G, src.G), B: maxU8(dst.B, src.B), A: src.A}
+})
+
+var blendDarken = blendWith(func(dst, src color.NRGBA) color.NRGBA {
+	return color.NRGBA{R: minU8(dst.R, src.R), G: minU8(dst.G, src.G), B: minU8(dst.B, src.B), A: src.A}
+})
+
+// blendAverage blends dst and src by averaging each channel. There's no
+// true median between only two samples - the median of any two values is
+// just their average - so this mode is named for what it actually computes
+// rather than a "median" blend it can't be.
+var blendAverage = blendWith(func(dst, src color.NRGBA) color.NRGBA {
+	avg := func(a, b uint8) uint8 { return uint8((uint16(a) + uint16(b)) / 2) }
+	return color.NRGBA{
+		R: avg(dst.R, src.R),
+		G: avg(dst.G, src.G),
+		B: avg(dst.B, src.B),
+		A: src.A,
+	}
+})
+
+// parseHexColor parses a Tiled color string - "#RRGGBB" or the "#AARRGGBB"
+// form Tiled itself writes - into color.NRGBA. It reports ok=false for an
+// empty or malformed string, so callers can fall back to their own default
+// instead of drawing black.
+func parseHexColor(s string) (c color.NRGBA, ok bool) {
+	s = strings.TrimPrefix(s, "#")
+	switch len(s) {
+	case 6:
+		s = "ff" + s
+	case 8:
+	default:
+		return color.NRGBA{}, false
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, false
+	}
+	return color.NRGBA{
+		A: uint8(v >> 24),
+		R: uint8(v >> 16),
+		G: uint8(v >> 8),
+		B: uint8(v),
+	}, true
+}
+
+// applyTintColor returns a copy of img with every pixel multiplied
+// component-wise by tint, per Tiled 1.9's per-layer tintcolor.
+func applyTintColor(img image.Image, tint *color.NRGBA) image.Image {
+	if tint == nil {
+		return img
+	}
+
+	b := img.Bounds()
+	out := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			out.SetNRGBA(x, y, color.NRGBA{
+				R: mulU8(c.R, tint.R),
+				G: mulU8(c.G, tint.G),
+				B: mulU8(c.B, tint.B),
+				A: mulU8(c.A, tint.A),
+			})
+		}
+	}
+	return out
+}
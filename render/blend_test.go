@@ -0,0 +1,111 @@
+/*
+Copyright (c) 2017 Lauris Bukšis-Haberkorns <lauris@nix.lv>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package render
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// TestBlendMultiplySeesDestination renders a src pixel with blendMultiply
+// onto a dst that already holds real (non-transparent) content, and checks
+// the result is the product of the two colors rather than just the source -
+// i.e. that blendWith actually reads the destination pixel via dst.NRGBAAt.
+// It calls blendMultiply directly, so renderChunk's chunk sub-images are not
+// involved.
+func TestBlendMultiplySeesDestination(t *testing.T) {
+	dst := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	dst.SetNRGBA(0, 0, color.NRGBA{R: 200, G: 200, B: 200, A: 255})
+
+	src := image.NewUniform(color.NRGBA{R: 100, G: 100, B: 100, A: 255})
+
+	blendMultiply(dst, image.Rect(0, 0, 1, 1), src, image.Point{}, nil)
+
+	got := dst.NRGBAAt(0, 0)
+	want := mulU8(200, 100)
+	if got.R != want || got.G != want || got.B != want {
+		t.Errorf("blendMultiply(dst=200, src=100) = %v, want R=G=B=%d (200*100/255)", got, want)
+	}
+}
+
+// TestBlendAverage checks blendAverage - the blend mode fixed in chunk0-4's
+// first review round for always equalling its own input rather than a true
+// average - actually averages dst and src.
+func TestBlendAverage(t *testing.T) {
+	dst := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	dst.SetNRGBA(0, 0, color.NRGBA{R: 0, G: 100, B: 200, A: 255})
+
+	src := image.NewUniform(color.NRGBA{R: 255, G: 100, B: 0, A: 255})
+
+	blendAverage(dst, image.Rect(0, 0, 1, 1), src, image.Point{}, nil)
+
+	got := dst.NRGBAAt(0, 0)
+	want := color.NRGBA{R: 127, G: 100, B: 100, A: 255}
+	if got != want {
+		t.Errorf("blendAverage(dst={0,100,200}, src={255,100,0}) = %v, want %v", got, want)
+	}
+}
+
+// TestResolveBlendMode checks the empty/built-in/registered name lookups
+// resolveBlendMode and RegisterBlendMode promise.
+func TestResolveBlendMode(t *testing.T) {
+	r := &Renderer{}
+
+	if fn := r.resolveBlendMode(""); fn == nil {
+		t.Error("resolveBlendMode(\"\") = nil, want blendNormal")
+	}
+	if fn := r.resolveBlendMode("multiply"); fn == nil {
+		t.Error("resolveBlendMode(\"multiply\") = nil, want blendMultiply")
+	}
+
+	called := false
+	r.RegisterBlendMode("custom", func(dst *image.NRGBA, rect image.Rectangle, src image.Image, sp image.Point, mask image.Image) {
+		called = true
+	})
+	r.resolveBlendMode("custom")(nil, image.Rectangle{}, nil, image.Point{}, nil)
+	if !called {
+		t.Error("resolveBlendMode did not return the BlendFunc registered under \"custom\"")
+	}
+}
+
+func TestParseHexColor(t *testing.T) {
+	tests := []struct {
+		in   string
+		want color.NRGBA
+		ok   bool
+	}{
+		{"#ff8000", color.NRGBA{R: 0xff, G: 0x80, B: 0x00, A: 0xff}, true},
+		{"ff8000", color.NRGBA{R: 0xff, G: 0x80, B: 0x00, A: 0xff}, true},
+		{"#80ff8000", color.NRGBA{A: 0x80, R: 0xff, G: 0x80, B: 0x00}, true},
+		{"", color.NRGBA{}, false},
+		{"#zzzzzz", color.NRGBA{}, false},
+	}
+
+	for _, tc := range tests {
+		got, ok := parseHexColor(tc.in)
+		if ok != tc.ok || (ok && got != tc.want) {
+			t.Errorf("parseHexColor(%q) = %v, %v, want %v, %v", tc.in, got, ok, tc.want, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+/*
+Copyright (c) 2017 Lauris Bukšis-Haberkorns <lauris@nix.lv>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package render
+
+import (
+	"image"
+
+	"github.com/disintegration/imaging"
+	"github.com/shipa988/go-tiled"
+)
+
+// rotateTileImage applies the horizontal, vertical and diagonal flip flags encoded
+// in a tile's GID to its image. Every orientation flips tiles the same way, so
+// RendererEngine implementations share this instead of reimplementing it each.
+func rotateTileImage(tile *tiled.LayerTile, img image.Image) image.Image {
+	if tile.DiagonalFlip {
+		img = imaging.Transpose(img)
+	}
+	if tile.HorizontalFlip {
+		img = imaging.FlipH(img)
+	}
+	if tile.VerticalFlip {
+		img = imaging.FlipV(img)
+	}
+	return img
+}
@@ -0,0 +1,145 @@
+/*
+Copyright (c) 2017 Lauris Bukšis-Haberkorns <lauris@nix.lv>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package render
+
+import (
+	"image"
+	"math"
+
+	"github.com/shipa988/go-tiled"
+)
+
+// HexagonalRendererEngine is a RendererEngine implementation for maps with
+// orientation "hexagonal". Like staggered maps, alternating rows or columns
+// are offset by half a tile, but the spacing between rows (or columns) along
+// the stagger axis is governed by the map's HexSideLength rather than a flat
+// half-tile.
+type HexagonalRendererEngine struct {
+	m *tiled.Map
+}
+
+// Init initializes the renderer engine with the given map.
+func (e *HexagonalRendererEngine) Init(m *tiled.Map) {
+	e.m = m
+}
+
+// sideLength returns the length, in pixels, of the flat sides of the hex
+// tile along the stagger axis, falling back to half a tile when the map
+// does not specify HexSideLength.
+func (e *HexagonalRendererEngine) sideLength() int {
+	if e.m.HexSideLength > 0 {
+		return e.m.HexSideLength
+	}
+	if staggerAxis(e.m) == staggerAxisX {
+		return e.m.TileWidth / 2
+	}
+	return e.m.TileHeight / 2
+}
+
+// staggers reports whether the row or column at the given index is one of
+// the offset ones, according to the map's stagger index (see staggerIndex).
+func (e *HexagonalRendererEngine) staggers(index int) bool {
+	if staggerIndex(e.m) == staggerIndexOdd {
+		return index%2 == 1
+	}
+	return index%2 == 0
+}
+
+// GetFinalImageSize returns the bounds of the fully rendered map image.
+func (e *HexagonalRendererEngine) GetFinalImageSize() image.Rectangle {
+	side := e.sideLength()
+
+	if staggerAxis(e.m) == staggerAxisX {
+		columnWidth := (e.m.TileWidth + side) / 2
+		w := columnWidth*e.m.Width + (e.m.TileWidth - columnWidth)
+		h := e.m.TileHeight*e.m.Height + e.m.TileHeight/2
+		return image.Rect(0, 0, w, h)
+	}
+
+	rowHeight := (e.m.TileHeight + side) / 2
+	w := e.m.TileWidth*e.m.Width + e.m.TileWidth/2
+	h := rowHeight*e.m.Height + (e.m.TileHeight - rowHeight)
+	return image.Rect(0, 0, w, h)
+}
+
+// GetTilePosition returns the pixel-space cell occupied by the tile at map
+// coordinates (x, y).
+func (e *HexagonalRendererEngine) GetTilePosition(x, y int) image.Rectangle {
+	tw, th := e.m.TileWidth, e.m.TileHeight
+	side := e.sideLength()
+
+	if staggerAxis(e.m) == staggerAxisX {
+		columnWidth := (tw + side) / 2
+		px := x * columnWidth
+		py := y * th
+		if e.staggers(x) {
+			py += th / 2
+		}
+		return image.Rect(px, py, px+tw, py+th)
+	}
+
+	rowHeight := (th + side) / 2
+	px := x * tw
+	py := y * rowHeight
+	if e.staggers(y) {
+		px += tw / 2
+	}
+	return image.Rect(px, py, px+tw, py+th)
+}
+
+// GetTrueTilePosition returns where a tile image of the given size should
+// actually be drawn for the cell at (x, y), anchoring it to the bottom-left
+// of the cell so tiles taller or wider than the grid still line up correctly.
+func (e *HexagonalRendererEngine) GetTrueTilePosition(tileRect image.Rectangle, x, y int) image.Rectangle {
+	pos := e.GetTilePosition(x, y)
+	return image.Rect(pos.Min.X, pos.Max.Y-tileRect.Dy(), pos.Min.X+tileRect.Dx(), pos.Max.Y)
+}
+
+// RotateTileImage applies the tile's flip flags to its image.
+func (e *HexagonalRendererEngine) RotateTileImage(tile *tiled.LayerTile, img image.Image) image.Image {
+	return rotateTileImage(tile, img)
+}
+
+// VisibleTileRange returns the tile index range intersecting view, the same
+// way StaggeredRendererEngine does: inverting GetTilePosition ignoring the
+// per-row/column stagger offset and letting tileRangeFromCorners' one-tile
+// padding absorb the difference.
+func (e *HexagonalRendererEngine) VisibleTileRange(view image.Rectangle) (xStart, xEnd, yStart, yEnd int) {
+	tw, th := float64(e.m.TileWidth), float64(e.m.TileHeight)
+	side := float64(e.sideLength())
+
+	invert := func(px, py int) (int, int) {
+		if staggerAxis(e.m) == staggerAxisX {
+			columnWidth := (tw + side) / 2
+			x := math.Floor(float64(px) / columnWidth)
+			y := math.Floor(float64(py) / th)
+			return int(x), int(y)
+		}
+		rowHeight := (th + side) / 2
+		x := math.Floor(float64(px) / tw)
+		y := math.Floor(float64(py) / rowHeight)
+		return int(x), int(y)
+	}
+
+	return tileRangeFromCorners(e.m, view, invert)
+}
@@ -0,0 +1,85 @@
+/*
+Copyright (c) 2017 Lauris Bukšis-Haberkorns <lauris@nix.lv>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+
+	"github.com/shipa988/go-tiled"
+)
+
+// renderImageLayer draws an image layer's backing image at its configured
+// offset, honoring its opacity the same way RenderLayer does for tiles.
+func (r *Renderer) renderImageLayer(il *tiled.ImageLayer) error {
+	if il.Image == nil || il.Image.Source == "" {
+		return nil
+	}
+
+	img, err := r.loadImage(il.Image.Source)
+	if err != nil {
+		return err
+	}
+
+	b := img.Bounds()
+	pos := image.Rect(int(il.OffsetX), int(il.OffsetY), int(il.OffsetX)+b.Dx(), int(il.OffsetY)+b.Dy())
+
+	if il.Opacity < 1 {
+		mask := image.NewUniform(color.Alpha{uint8(il.Opacity * 255)})
+		draw.DrawMask(r.Result, pos, img, b.Min, mask, mask.Bounds().Min, draw.Over)
+		return nil
+	}
+
+	draw.Draw(r.Result, pos, img, b.Min, draw.Over)
+	return nil
+}
+
+// loadImage opens and decodes source, resolved relative to the map file,
+// through the map's loader filesystem if it has one - the same lookup
+// getTileImage uses for tileset images.
+func (r *Renderer) loadImage(source string) (image.Image, error) {
+	path := r.m.GetFileFullPath(source)
+
+	l := r.m.Loader
+	if l == nil || l.FileSystem == nil {
+		sf, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer sf.Close()
+
+		img, _, err := image.Decode(sf)
+		return img, err
+	}
+
+	sf, err := l.FileSystem.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer sf.Close()
+
+	img, _, err := image.Decode(sf)
+	return img, err
+}
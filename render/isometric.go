@@ -0,0 +1,94 @@
+/*
+Copyright (c) 2017 Lauris Bukšis-Haberkorns <lauris@nix.lv>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package render
+
+import (
+	"image"
+	"math"
+
+	"github.com/shipa988/go-tiled"
+)
+
+// IsometricRendererEngine is a RendererEngine implementation for maps with
+// orientation "isometric", where the grid is drawn as a diamond.
+type IsometricRendererEngine struct {
+	m *tiled.Map
+}
+
+// Init initializes the renderer engine with the given map.
+func (e *IsometricRendererEngine) Init(m *tiled.Map) {
+	e.m = m
+}
+
+// GetFinalImageSize returns the bounds of the fully rendered map image.
+func (e *IsometricRendererEngine) GetFinalImageSize() image.Rectangle {
+	w := (e.m.Width + e.m.Height) * e.m.TileWidth / 2
+	h := (e.m.Width + e.m.Height) * e.m.TileHeight / 2
+	return image.Rect(0, 0, w, h)
+}
+
+// GetTilePosition returns the pixel-space cell occupied by the tile at map
+// coordinates (x, y), projected onto the isometric diamond grid.
+func (e *IsometricRendererEngine) GetTilePosition(x, y int) image.Rectangle {
+	halfWidth := e.m.TileWidth / 2
+	halfHeight := e.m.TileHeight / 2
+	originX := (e.m.Height - 1) * halfWidth
+
+	px := originX + (x-y)*halfWidth
+	py := (x + y) * halfHeight
+
+	return image.Rect(px, py, px+e.m.TileWidth, py+e.m.TileHeight)
+}
+
+// GetTrueTilePosition returns where a tile image of the given size should
+// actually be drawn for the cell at (x, y), anchoring it to the bottom-left
+// of the cell so tiles taller or wider than the grid still line up correctly.
+func (e *IsometricRendererEngine) GetTrueTilePosition(tileRect image.Rectangle, x, y int) image.Rectangle {
+	pos := e.GetTilePosition(x, y)
+	return image.Rect(pos.Min.X, pos.Max.Y-tileRect.Dy(), pos.Min.X+tileRect.Dx(), pos.Max.Y)
+}
+
+// RotateTileImage applies the tile's flip flags to its image.
+func (e *IsometricRendererEngine) RotateTileImage(tile *tiled.LayerTile, img image.Image) image.Image {
+	return rotateTileImage(tile, img)
+}
+
+// VisibleTileRange returns the tile index range intersecting view, by
+// inverting the diamond projection GetTilePosition applies. The inverse is
+// exact, so tileRangeFromCorners only needs to pad it by one tile for
+// oversized, overlapping tiles.
+func (e *IsometricRendererEngine) VisibleTileRange(view image.Rectangle) (xStart, xEnd, yStart, yEnd int) {
+	halfWidth := float64(e.m.TileWidth) / 2
+	halfHeight := float64(e.m.TileHeight) / 2
+	originX := float64(e.m.Height-1) * halfWidth
+
+	invert := func(px, py int) (int, int) {
+		u := (float64(px) - originX) / halfWidth // x - y
+		v := float64(py) / halfHeight            // x + y
+		x := math.Floor((u + v) / 2)
+		y := math.Floor((v - u) / 2)
+		return int(x), int(y)
+	}
+
+	return tileRangeFromCorners(e.m, view, invert)
+}
@@ -0,0 +1,311 @@
+/*
+Copyright (c) 2017 Lauris Bukšis-Haberkorns <lauris@nix.lv>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/disintegration/imaging"
+	"github.com/shipa988/go-tiled"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// RenderObjectGroup renders a single object group: tile objects, shapes
+// (rectangle, ellipse, polygon, polyline) and text objects. Unlike
+// RenderLayer it draws straight into r.Result in object order, since object
+// groups are typically small and don't benefit from chunked rendering.
+//
+// go-tiled has no dedicated point-object field, so a Tiled point object
+// (which has no width/height of its own) falls into the default
+// zero-sized-rectangle case below rather than drawing a marker.
+func (r *Renderer) RenderObjectGroup(index int) (LayerObjects, error) {
+	return r.renderObjectGroup(r.m.ObjectGroups[index])
+}
+
+func (r *Renderer) renderObjectGroup(group *tiled.ObjectGroup) (LayerObjects, error) {
+	lo := LayerObjects{}
+
+	for _, obj := range group.Objects {
+		if !obj.Visible {
+			continue
+		}
+
+		switch {
+		case obj.GID != 0:
+			to, err := r.renderTileObject(obj)
+			if err != nil {
+				return lo, err
+			}
+			lo.TileObjects = append(lo.TileObjects, to)
+		case obj.Text != nil:
+			r.renderTextObject(group, obj)
+		case len(obj.Polygons) > 0:
+			r.fillPolygon(group, obj, pointsOf(obj.Polygons[0].Points))
+		case len(obj.PolyLines) > 0:
+			r.strokePolyline(group, obj, pointsOf(obj.PolyLines[0].Points))
+		case len(obj.Ellipses) > 0:
+			r.fillPolygon(group, obj, ellipsePoints(obj.Width, obj.Height))
+		default:
+			r.fillPolygon(group, obj, rectanglePoints(obj.Width, obj.Height))
+		}
+	}
+
+	return lo, nil
+}
+
+// renderTileObject draws a tile-object: the tileset tile referenced by
+// obj.GID, scaled to the object's Width/Height and rotated clockwise by
+// obj.Rotation degrees around its bottom-left corner (obj.X, obj.Y), the
+// point Tiled anchors tile objects at.
+func (r *Renderer) renderTileObject(obj *tiled.Object) (TileObject, error) {
+	tile, err := r.m.TileGIDToTile(obj.GID)
+	if err != nil {
+		return TileObject{}, err
+	}
+	img, err := r.getTileImage(tile)
+	if err != nil {
+		return TileObject{}, err
+	}
+
+	w, h := int(obj.Width), int(obj.Height)
+	b := img.Bounds()
+	if w == 0 {
+		w = b.Dx()
+	}
+	if h == 0 {
+		h = b.Dy()
+	}
+	if w != b.Dx() || h != b.Dy() {
+		img = imaging.Resize(img, w, h, imaging.Lanczos)
+	}
+
+	// Tiled anchors tile objects at their bottom-left corner.
+	drawn := image.Image(img)
+	pos := image.Rect(int(obj.X), int(obj.Y)-h, int(obj.X)+w, int(obj.Y))
+	if obj.Rotation != 0 {
+		drawn = imaging.Rotate(drawn, -obj.Rotation, color.Transparent)
+		// imaging.Rotate keeps the image centered in its grown bounds, so
+		// move that center around the anchor the same way rotatedPoint does.
+		cx, cy := rotatedPoint(obj, tiled.Point{X: float64(w) / 2, Y: -float64(h) / 2})
+		rb := drawn.Bounds()
+		minX := int(math.Round(cx - float64(rb.Dx())/2))
+		minY := int(math.Round(cy - float64(rb.Dy())/2))
+		pos = image.Rect(minX, minY, minX+rb.Dx(), minY+rb.Dy())
+	}
+
+	draw.Draw(r.Result, pos, drawn, drawn.Bounds().Min, draw.Over)
+
+	return TileObject{TileImage: drawn, TilePos: pos}, nil
+}
+
+// renderTextObject draws obj.Text.Text at the object's position using a
+// built-in monospace bitmap font; golang.org/x/image/font only handles
+// glyph layout and drawing here; turning FontFamily/PixelSize into an
+// actual scalable font is left to a future change.
+func (r *Renderer) renderTextObject(group *tiled.ObjectGroup, obj *tiled.Object) {
+	d := &font.Drawer{
+		Dst:  r.Result,
+		Src:  image.NewUniform(objectColor(group, obj)),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(int(obj.X), int(obj.Y)+basicfont.Face7x13.Height),
+	}
+	d.DrawString(obj.Text.Text)
+}
+
+// pointsOf dereferences a go-tiled *Points (itself a []*Point) into a plain
+// []*tiled.Point, treating a nil Points - an empty polygon/polyline - as no
+// points at all instead of panicking.
+func pointsOf(points *tiled.Points) []*tiled.Point {
+	if points == nil {
+		return nil
+	}
+	return *points
+}
+
+// fillPolygon draws the polygon described by points (in object-local
+// coordinates) the way Tiled's own editor does: a translucent fill in the
+// group or object's color plus a solid stroked outline, after rotating each
+// point by obj.Rotation and translating by obj.X/obj.Y. A solid opaque fill
+// would paint every annotation shape as a filled block over the map.
+func (r *Renderer) fillPolygon(group *tiled.ObjectGroup, obj *tiled.Object, points []*tiled.Point) {
+	if len(points) < 3 {
+		return
+	}
+
+	bounds := polygonBounds(obj, points)
+	if bounds.Empty() {
+		return
+	}
+
+	rast := vector.NewRasterizer(bounds.Dx(), bounds.Dy())
+	toLocal := func(p *tiled.Point) (float32, float32) {
+		px, py := rotatedPoint(obj, *p)
+		return float32(px) - float32(bounds.Min.X), float32(py) - float32(bounds.Min.Y)
+	}
+
+	startX, startY := toLocal(points[0])
+	rast.MoveTo(startX, startY)
+	for _, p := range points[1:] {
+		x, y := toLocal(p)
+		rast.LineTo(x, y)
+	}
+	rast.ClosePath()
+
+	mask := image.NewAlpha(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	rast.Draw(mask, mask.Bounds(), image.Opaque, image.Point{})
+
+	col := objectColor(group, obj)
+	fill := image.NewUniform(color.NRGBA{R: col.R, G: col.G, B: col.B, A: shapeFillAlpha})
+	draw.DrawMask(r.Result, bounds, fill, bounds.Min, mask, image.Point{}, draw.Over)
+
+	closed := append(append([]*tiled.Point{}, points...), points[0])
+	r.strokePolyline(group, obj, closed)
+}
+
+// strokePolyline draws straight segments between consecutive points (in
+// object-local coordinates), after rotating and translating them the same
+// way fillPolygon does.
+func (r *Renderer) strokePolyline(group *tiled.ObjectGroup, obj *tiled.Object, points []*tiled.Point) {
+	col := objectColor(group, obj)
+	for i := 1; i < len(points); i++ {
+		x0, y0 := rotatedPoint(obj, *points[i-1])
+		x1, y1 := rotatedPoint(obj, *points[i])
+		drawLine(r.Result, int(x0), int(y0), int(x1), int(y1), col)
+	}
+}
+
+// rotatedPoint rotates p (in object-local coordinates) by obj.Rotation
+// degrees around the origin, then translates it to map coordinates by
+// obj.X/obj.Y - the transform Tiled applies to every object shape.
+func rotatedPoint(obj *tiled.Object, p tiled.Point) (float64, float64) {
+	if obj.Rotation == 0 {
+		return obj.X + p.X, obj.Y + p.Y
+	}
+
+	rad := obj.Rotation * math.Pi / 180
+	sin, cos := math.Sin(rad), math.Cos(rad)
+	return obj.X + p.X*cos - p.Y*sin, obj.Y + p.X*sin + p.Y*cos
+}
+
+// polygonBounds returns the smallest rectangle covering every rotated point.
+func polygonBounds(obj *tiled.Object, points []*tiled.Point) image.Rectangle {
+	x0, y0 := rotatedPoint(obj, *points[0])
+	minX, maxX, minY, maxY := x0, x0, y0, y0
+	for _, p := range points[1:] {
+		x, y := rotatedPoint(obj, *p)
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+	return image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX))+1, int(math.Ceil(maxY))+1)
+}
+
+// rectanglePoints returns the corners of a w x h rectangle anchored at its
+// own origin, the shape Tiled objects default to when no other shape is set.
+func rectanglePoints(w, h float64) []*tiled.Point {
+	return []*tiled.Point{{X: 0, Y: 0}, {X: w, Y: 0}, {X: w, Y: h}, {X: 0, Y: h}}
+}
+
+// ellipsePoints approximates a w x h ellipse inscribed in its bounding box
+// with a 48-segment polygon, which fillPolygon fills and outlines like any
+// other polygon. go-tiled's Ellipse itself carries no size of its own - an object
+// is sized by its own Width/Height regardless of shape - so those are what
+// gets passed in here.
+func ellipsePoints(w, h float64) []*tiled.Point {
+	const segments = 48
+	cx, cy := w/2, h/2
+	points := make([]*tiled.Point, segments)
+	for i := range points {
+		a := 2 * math.Pi * float64(i) / segments
+		points[i] = &tiled.Point{X: cx + cx*math.Cos(a), Y: cy + cy*math.Sin(a)}
+	}
+	return points
+}
+
+// defaultObjectColor is the color Tiled itself falls back to for an object
+// whose group sets none: a mid-gray outline/fill rather than opaque black,
+// so an unannotated object group doesn't paint solid boxes over the map.
+var defaultObjectColor = color.NRGBA{R: 0xa0, G: 0xa0, B: 0xa0, A: 0xff}
+
+// shapeFillAlpha is how translucent fillPolygon's fill is relative to
+// objectColor's full alpha, matching Tiled's own editor rendering of
+// rectangle/ellipse/polygon objects as a solid outline over a faint fill
+// rather than a solid block.
+const shapeFillAlpha = 0x50
+
+// objectColor picks the stroke color for obj: a text object's own color if
+// it has one, else its object group's color, else defaultObjectColor.
+func objectColor(group *tiled.ObjectGroup, obj *tiled.Object) color.NRGBA {
+	if obj.Text != nil {
+		if c, ok := parseHexColor(obj.Text.Color); ok {
+			return c
+		}
+	}
+	if c, ok := parseHexColor(group.Color); ok {
+		return c
+	}
+	return defaultObjectColor
+}
+
+// drawLine draws a straight line from (x0,y0) to (x1,y1) using Bresenham's
+// algorithm.
+func drawLine(img draw.Image, x0, y0, x1, y1 int, col color.Color) {
+	dx := absInt(x1 - x0)
+	dy := -absInt(y1 - y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	err := dx + dy
+
+	for {
+		img.Set(x0, y0, col)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,78 @@
+/*
+Copyright (c) 2017 Lauris Bukšis-Haberkorns <lauris@nix.lv>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package render
+
+import (
+	"testing"
+
+	"github.com/shipa988/go-tiled"
+)
+
+// TestObjectColorDefaultIsNotOpaqueBlack checks that an object group with no
+// color of its own doesn't make fillPolygon paint shapes as solid black
+// boxes - the chunk0-5 bug.
+func TestObjectColorDefaultIsNotOpaqueBlack(t *testing.T) {
+	group := &tiled.ObjectGroup{}
+	obj := &tiled.Object{}
+
+	c := objectColor(group, obj)
+	if c.R == 0 && c.G == 0 && c.B == 0 && c.A == 255 {
+		t.Errorf("objectColor with no group color = %v, want something other than opaque black", c)
+	}
+}
+
+// TestObjectColorGroupColor checks a group's own color still wins over the
+// default.
+func TestObjectColorGroupColor(t *testing.T) {
+	group := &tiled.ObjectGroup{Color: "#ff0000"}
+	obj := &tiled.Object{}
+
+	c := objectColor(group, obj)
+	if c.R != 0xff || c.G != 0 || c.B != 0 {
+		t.Errorf("objectColor with group.Color=#ff0000 = %v, want opaque red", c)
+	}
+}
+
+// TestFillPolygonNotFullyOpaque renders a rectangle object with no group
+// color and checks the fill isn't opaque - Tiled's own editor draws object
+// shapes as a translucent fill plus a solid outline, not a solid block.
+func TestFillPolygonNotFullyOpaque(t *testing.T) {
+	m := &tiled.Map{Width: 10, Height: 10, TileWidth: 16, TileHeight: 16, Orientation: "orthogonal"}
+	r, err := NewRenderer(m)
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+
+	group := &tiled.ObjectGroup{}
+	obj := &tiled.Object{X: 10, Y: 10, Width: 20, Height: 20}
+	r.fillPolygon(group, obj, rectanglePoints(obj.Width, obj.Height))
+
+	// The rectangle's interior, away from its stroked outline.
+	c := r.Result.NRGBAAt(20, 20)
+	if c.A == 0 {
+		t.Fatal("fillPolygon drew nothing at all")
+	}
+	if c.A == 255 {
+		t.Errorf("fillPolygon's interior pixel alpha = %d, want a translucent fill, not opaque", c.A)
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright (c) 2017 Lauris Bukšis-Haberkorns <lauris@nix.lv>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package render
+
+import (
+	"image"
+
+	"github.com/shipa988/go-tiled"
+)
+
+// OrthogonalRendererEngine is a RendererEngine implementation for maps with
+// orientation "orthogonal", i.e. a plain rectangular grid.
+type OrthogonalRendererEngine struct {
+	m *tiled.Map
+}
+
+// Init initializes the renderer engine with the given map.
+func (e *OrthogonalRendererEngine) Init(m *tiled.Map) {
+	e.m = m
+}
+
+// GetFinalImageSize returns the bounds of the fully rendered map image.
+func (e *OrthogonalRendererEngine) GetFinalImageSize() image.Rectangle {
+	return image.Rect(0, 0, e.m.Width*e.m.TileWidth, e.m.Height*e.m.TileHeight)
+}
+
+// GetTilePosition returns the pixel-space cell occupied by the tile at map
+// coordinates (x, y).
+func (e *OrthogonalRendererEngine) GetTilePosition(x, y int) image.Rectangle {
+	return image.Rect(x*e.m.TileWidth, y*e.m.TileHeight, (x+1)*e.m.TileWidth, (y+1)*e.m.TileHeight)
+}
+
+// GetTrueTilePosition returns where a tile image of the given size should
+// actually be drawn for the cell at (x, y), anchoring it to the bottom-left
+// of the cell so tiles taller or wider than the grid still line up correctly.
+func (e *OrthogonalRendererEngine) GetTrueTilePosition(tileRect image.Rectangle, x, y int) image.Rectangle {
+	pos := e.GetTilePosition(x, y)
+	return image.Rect(pos.Min.X, pos.Max.Y-tileRect.Dy(), pos.Min.X+tileRect.Dx(), pos.Max.Y)
+}
+
+// RotateTileImage applies the tile's flip flags to its image.
+func (e *OrthogonalRendererEngine) RotateTileImage(tile *tiled.LayerTile, img image.Image) image.Image {
+	return rotateTileImage(tile, img)
+}
+
+// VisibleTileRange returns the tile index range intersecting view, padded by
+// one tile to cover any oversized tile straddling the edge and clamped to
+// the map's bounds.
+func (e *OrthogonalRendererEngine) VisibleTileRange(view image.Rectangle) (xStart, xEnd, yStart, yEnd int) {
+	xStart = clampInt(view.Min.X/e.m.TileWidth-1, 0, e.m.Width)
+	xEnd = clampInt(ceilDiv(view.Max.X, e.m.TileWidth)+1, 0, e.m.Width)
+	yStart = clampInt(view.Min.Y/e.m.TileHeight-1, 0, e.m.Height)
+	yEnd = clampInt(ceilDiv(view.Max.Y, e.m.TileHeight)+1, 0, e.m.Height)
+	return
+}
@@ -0,0 +1,397 @@
+/*
+Copyright (c) 2017 Lauris Bukšis-Haberkorns <lauris@nix.lv>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+
+	"github.com/shipa988/go-tiled"
+)
+
+// defaultChunkSize is the width and height, in tiles, of the blocks
+// RenderLayer splits a layer into for its worker pool.
+const defaultChunkSize = 64
+
+// SetParallelism sets how many chunk workers RenderLayer uses to render a
+// layer concurrently. It defaults to runtime.NumCPU(); pass 1 to render
+// single-threaded.
+func (r *Renderer) SetParallelism(n int) {
+	if n < 1 {
+		n = 1
+	}
+	r.parallelism = n
+}
+
+// tileChunk is a rectangular block of tile indexes, rendered as a unit by a
+// single worker.
+type tileChunk struct {
+	xStart, xEnd int // xEnd exclusive
+	yStart, yEnd int // yEnd exclusive
+	xStep, yStep int // direction renderTileRangeInto should walk this chunk's tiles in
+}
+
+// chunkTileRange splits the [xStart,xEnd) x [yStart,yEnd) tile index range -
+// walked in the direction given by xStep/yStep for RenderOrder - into
+// size x size chunks, in that same direction: renderChunks composites
+// chunk results back-to-front in the order this slice returns them, and
+// each chunk carries xStep/yStep so renderTileRangeInto walks its own
+// tiles in that direction too. That's what makes right-up/left-down/
+// left-up actually draw differently from the default right-down, for maps
+// with overlapping (oversized) tiles.
+func chunkTileRange(xStart, xEnd, xStep, yStart, yEnd, yStep, size int) []tileChunk {
+	xLo, xHi := orderedBounds(xStart, xEnd, xStep)
+	yLo, yHi := orderedBounds(yStart, yEnd, yStep)
+
+	xOffsets := chunkOffsets(xLo, xHi, size, xStep < 0)
+	yOffsets := chunkOffsets(yLo, yHi, size, yStep < 0)
+
+	var chunks []tileChunk
+	for _, y := range yOffsets {
+		yEndChunk := y + size
+		if yEndChunk > yHi {
+			yEndChunk = yHi
+		}
+		for _, x := range xOffsets {
+			xEndChunk := x + size
+			if xEndChunk > xHi {
+				xEndChunk = xHi
+			}
+			chunks = append(chunks, tileChunk{xStart: x, xEnd: xEndChunk, yStart: y, yEnd: yEndChunk, xStep: xStep, yStep: yStep})
+		}
+	}
+	return chunks
+}
+
+// orderedBounds returns the ascending [lo, hi) form of a start/end/step
+// range that may walk forwards (step > 0) or backwards (step < 0).
+func orderedBounds(start, end, step int) (lo, hi int) {
+	if step > 0 {
+		return start, end
+	}
+	return end + 1, start + 1
+}
+
+// chunkOffsets returns the chunk start offsets covering [lo,hi) in strides
+// of size, ascending by default or descending when reverse is set, so
+// chunkTileRange's chunk order follows the map's RenderOrder instead of
+// always walking the grid top-left to bottom-right.
+func chunkOffsets(lo, hi, size int, reverse bool) []int {
+	var offsets []int
+	for x := lo; x < hi; x += size {
+		offsets = append(offsets, x)
+	}
+	if reverse {
+		for i, j := 0, len(offsets)-1; i < j; i, j = i+1, j-1 {
+			offsets[i], offsets[j] = offsets[j], offsets[i]
+		}
+	}
+	return offsets
+}
+
+// warmTileCache sequentially decodes and caches the image for every tile
+// used by layer, including its animation frames, so the worker pool spawned
+// by RenderLayer can treat the cache as read-only.
+func (r *Renderer) warmTileCache(layer *tiled.Layer) error {
+	for _, tile := range layer.Tiles {
+		if tile.IsNil() {
+			continue
+		}
+		if _, err := r.getTileImage(tile); err != nil {
+			return err
+		}
+		for _, frame := range tile.Animation {
+			ft, err := r.m.TileGIDToTile(frame.TileID + tile.Tileset.FirstGID)
+			if err != nil {
+				continue
+			}
+			if _, err := r.getTileImage(ft); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// chunkResult is what a worker produces for a single tileChunk.
+type chunkResult struct {
+	bounds  image.Rectangle
+	img     *image.NRGBA
+	objects LayerObjects
+}
+
+// indexedChunkResult tags a chunkResult with its position in the chunks
+// slice renderChunks was given, so results coming back from workers out of
+// order can still be composited in chunkTileRange's own order afterwards.
+type indexedChunkResult struct {
+	idx int
+	res chunkResult
+}
+
+// renderChunks runs chunks through a pool of r.parallelism workers, each
+// rendering its chunk onto its own sub-image via renderChunk. Workers may
+// finish in any order, but results are composited into r.Result in
+// chunks' own order - the order chunkTileRange built to match the layer's
+// RenderOrder - so overlapping chunk edges still draw back-to-front the
+// way the map asks for, even though decoding/rendering itself is parallel.
+func (r *Renderer) renderChunks(layer *tiled.Layer, chunks []tileChunk) (LayerObjects, error) {
+	jobs := make(chan int)
+	results := make(chan indexedChunkResult)
+	errs := make(chan error, 1)
+
+	var wg sync.WaitGroup
+	workers := r.parallelism
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				res, err := r.renderChunk(layer, chunks[idx])
+				if err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+					continue
+				}
+				results <- indexedChunkResult{idx: idx, res: res}
+			}
+		}()
+	}
+
+	go func() {
+		for i := range chunks {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	ordered := make([]*chunkResult, len(chunks))
+	for ir := range results {
+		res := ir.res
+		ordered[ir.idx] = &res
+	}
+
+	lo := LayerObjects{XCollision: map[float64][]float64{}, YCollision: map[float64][]float64{}}
+	for _, res := range ordered {
+		if res == nil {
+			continue // that chunk's worker reported an error, returned below
+		}
+		draw.Draw(r.Result, res.bounds, res.img, res.img.Bounds().Min, draw.Over)
+		lo.TileObjects = append(lo.TileObjects, res.objects.TileObjects...)
+		lo.Animation = append(lo.Animation, res.objects.Animation...)
+		r.Animations = append(r.Animations, res.objects.Animation...)
+		for k, v := range res.objects.XCollision {
+			lo.XCollision[k] = append(lo.XCollision[k], v...)
+		}
+		for k, v := range res.objects.YCollision {
+			lo.YCollision[k] = append(lo.YCollision[k], v...)
+		}
+	}
+
+	select {
+	case err := <-errs:
+		return lo, err
+	default:
+		return lo, nil
+	}
+}
+
+// chunkPixelBounds returns the pixel-space bounds a chunk's tiles can draw
+// into, padded by one tile in every direction to give room for tiles whose
+// image is larger than the grid cell (see GetTrueTilePosition), then clamped
+// to the final image.
+//
+// It unions all four corner tiles of the chunk's index range, not just
+// (xStart,yStart) and (xEnd-1,yEnd-1): those two are opposite corners of the
+// chunk's tile-index rectangle, which is only the same thing as opposite
+// corners of its pixel-space footprint for an orthogonal grid. On an
+// isometric map GetTilePosition(x,y)'s pixel X depends on (x-y), so the
+// chunk's other two corners - (xEnd-1,yStart) and (xStart,yEnd-1) - can
+// stick out further left/right than either of the two used here, and
+// skipping them clips away real chunk content.
+func (r *Renderer) chunkPixelBounds(c tileChunk) image.Rectangle {
+	bounds := r.engine.GetTilePosition(c.xStart, c.yStart)
+	bounds = bounds.Union(r.engine.GetTilePosition(c.xEnd-1, c.yStart))
+	bounds = bounds.Union(r.engine.GetTilePosition(c.xStart, c.yEnd-1))
+	bounds = bounds.Union(r.engine.GetTilePosition(c.xEnd-1, c.yEnd-1))
+
+	bounds = image.Rect(
+		bounds.Min.X-r.m.TileWidth, bounds.Min.Y-r.m.TileHeight,
+		bounds.Max.X+r.m.TileWidth, bounds.Max.Y+r.m.TileHeight,
+	)
+
+	return bounds.Intersect(r.Result.Bounds())
+}
+
+// renderChunk renders the tiles in the index range covered by c onto a
+// sub-image sized by chunkPixelBounds, and collects their collisions and
+// animations. Tiles within a chunk are drawn in the direction c.xStep/
+// c.yStep calls for, so oversized, overlapping tiles still paint
+// back-to-front per the layer's RenderOrder.
+//
+// The sub-image is seeded with r.Result's own current content under bounds,
+// rather than left transparent, so a non-normal blend mode's combine
+// function actually sees what's already on the map instead of transparent
+// black. This is safe to read concurrently across chunk workers: nothing
+// writes to r.Result until renderChunks composites every chunk's result back
+// in afterwards, sequentially.
+func (r *Renderer) renderChunk(layer *tiled.Layer, c tileChunk) (chunkResult, error) {
+	bounds := r.chunkPixelBounds(c)
+	sub := image.NewNRGBA(bounds)
+	draw.Draw(sub, bounds, r.Result, bounds.Min, draw.Src)
+
+	objects, err := r.renderTileRangeInto(sub, layer, c.xStart, c.xEnd, c.xStep, c.yStart, c.yEnd, c.yStep)
+	if err != nil {
+		return chunkResult{}, err
+	}
+
+	return chunkResult{bounds: bounds, img: sub, objects: objects}, nil
+}
+
+// renderTileRangeInto draws layer's tiles in [xStart,xEnd) x [yStart,yEnd),
+// walked in the direction xStep/yStep call for, straight into dst - in
+// dst's own coordinate space, so callers whose dst isn't rooted at (0,0) (a
+// chunk sub-image, a viewport) don't need to translate positions
+// themselves; the layer's BlendFunc writes through dst.SetNRGBA, which drops
+// pixels outside dst's bounds. It collects the same collisions and animations
+// renderChunk used to compute inline.
+//
+// go-tiled's Layer has no BlendMode/TintColor fields of its own, so those
+// are read from the layer's custom "blendmode"/"tintcolor" properties
+// instead - set them in the Tiled editor's layer property panel to opt in.
+func (r *Renderer) renderTileRangeInto(dst *image.NRGBA, layer *tiled.Layer, xStart, xEnd, xStep, yStart, yEnd, yStep int) (LayerObjects, error) {
+	colmapX := map[float64][]float64{}
+	colmapY := map[float64][]float64{}
+	objects := LayerObjects{}
+
+	blend := r.resolveBlendMode(layer.Properties.GetString("blendmode"))
+	var tint *color.NRGBA
+	if c, ok := parseHexColor(layer.Properties.GetString("tintcolor")); ok {
+		tint = &c
+	}
+
+	yFrom, yTo, yInc := rangeStep(yStart, yEnd, yStep)
+	xFrom, xTo, xInc := rangeStep(xStart, xEnd, xStep)
+
+	for y := yFrom; y != yTo; y += yInc {
+		for x := xFrom; x != xTo; x += xInc {
+			ltile := layer.Tiles[y*r.m.Width+x]
+			if ltile.IsNil() {
+				continue
+			}
+
+			img, err := r.getTileImage(ltile)
+			if err != nil {
+				return LayerObjects{}, err
+			}
+			//position of tile knowing it size
+			pos := r.engine.GetTrueTilePosition(img.Bounds(), x, y)
+			//get all collisions of this tile
+			for _, collision := range ltile.Collision {
+				if collision.Max.Y != 0 {
+					pymin := float64(pos.Min.Y + collision.Min.Y)
+					pymax := float64(pos.Min.Y + collision.Max.Y)
+					pxmin := float64(pos.Min.X + collision.Min.X)
+					pxmax := float64(pos.Min.X + collision.Max.X)
+					for y := pymin; y <= pymax; y++ {
+						for x := pxmin; x <= pxmax; x++ {
+							colmapY[y] = append(colmapY[y], x)
+							colmapX[x] = append(colmapX[x], y)
+						}
+					}
+				}
+			}
+			//get all animation of this tile
+			if len(ltile.Animation) > 0 {
+				animationTile := AnimationTile{
+					TilePos: pos,
+				}
+				for _, tile := range ltile.Tileset.Tiles {
+					if tile.ID == ltile.ID {
+						animationTile.TilePlane = tile.Type
+						break
+					}
+				}
+				animgs := []image.Image{img}
+				durations := []uint32{ltile.Animation[0].Duration}
+				for n := 1; n < len(ltile.Animation); n++ {
+					lt, err := r.m.TileGIDToTile(ltile.Animation[n].TileID + ltile.Tileset.FirstGID)
+					if err != nil {
+						continue
+					}
+					animg, err := r.getTileImage(lt)
+					if err != nil {
+						continue
+					}
+					animgs = append(animgs, animg)
+					durations = append(durations, ltile.Animation[n].Duration)
+				}
+
+				animationTile.TileImages = animgs
+				animationTile.FrameDurations = durations
+				for _, d := range durations {
+					animationTile.Duration += d
+				}
+				objects.Animation = append(objects.Animation, animationTile)
+			}
+
+			//get all tiles in this layer
+			objects.TileObjects = append(objects.TileObjects, TileObject{
+				TileImage: img,
+				TilePos:   pos,
+			})
+
+			drawImg := applyTintColor(img, tint)
+
+			var mask image.Image
+			if layer.Opacity < 1 {
+				mask = image.NewUniform(color.Alpha{uint8(layer.Opacity * 255)})
+			}
+
+			blend(dst, pos, drawImg, drawImg.Bounds().Min, mask)
+		}
+	}
+
+	objects.XCollision = colmapX
+	objects.YCollision = colmapY
+	return objects, nil
+}
+
+// rangeStep returns the (from, to, inc) triple that walks [lo,hi) ascending
+// when step >= 0, or descending when step < 0, so a loop written as
+// `for i := from; i != to; i += inc` visits every index in [lo,hi) in the
+// direction the map's RenderOrder calls for.
+func rangeStep(lo, hi, step int) (from, to, inc int) {
+	if step < 0 {
+		return hi - 1, lo - 1, -1
+	}
+	return lo, hi, 1
+}
@@ -0,0 +1,105 @@
+/*
+Copyright (c) 2017 Lauris Bukšis-Haberkorns <lauris@nix.lv>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package render
+
+import (
+	"testing"
+)
+
+// TestChunkPixelBoundsIsometric reproduces the 8x8, 32px isometric map from
+// the chunk-bounds bug report: the whole map is one 64-tile chunk, whose
+// pixel footprint spans the full 256x256 result image. Unioning only the
+// (0,0)/(7,7) corners clips that down to x in [80,176) - exactly the
+// too-narrow range the bug produced - because an isometric tile's pixel X
+// depends on (x-y), so the chunk's other two corners stick out further
+// left/right than either of those two.
+func TestChunkPixelBoundsIsometric(t *testing.T) {
+	m, _ := newTestMap(t, "isometric", 8, 8, 32)
+
+	r, err := NewRenderer(m)
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+
+	got := r.chunkPixelBounds(tileChunk{xStart: 0, xEnd: 8, yStart: 0, yEnd: 8, xStep: 1, yStep: 1})
+	want := r.Result.Bounds()
+	if got != want {
+		t.Errorf("chunkPixelBounds for the whole-map chunk = %v, want the full result bounds %v (chunk content is being clipped)", got, want)
+	}
+}
+
+// TestRenderLayerIsometric renders the same map end to end and checks that a
+// tile known to sit at the diamond's left tip (chunk content the two-corner
+// bug clipped away) actually makes it into the result image.
+func TestRenderLayerIsometric(t *testing.T) {
+	m, _ := newTestMap(t, "isometric", 8, 8, 32)
+
+	r, err := NewRenderer(m)
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	if _, err := r.RenderLayer(0); err != nil {
+		t.Fatalf("RenderLayer: %v", err)
+	}
+
+	pos := r.engine.GetTilePosition(0, 7) // the diamond's left tip
+	c := r.Result.NRGBAAt(pos.Min.X, pos.Min.Y+pos.Dy()/2)
+	if c.A == 0 {
+		t.Errorf("tile at the diamond's left tip (%v) was not drawn; got transparent pixel %v", pos, c)
+	}
+}
+
+// BenchmarkRenderLayerParallelism renders the same large orthogonal layer at
+// parallelism 1 and at runtime.NumCPU(), demonstrating the chunked worker
+// pool's speedup over sequential rendering that the parallel-chunking
+// request asked for. Run with -bench and compare the two reported times.
+func BenchmarkRenderLayerParallelism(b *testing.B) {
+	m, _ := newTestMap(b, "orthogonal", 256, 256, 16)
+
+	for _, workers := range []int{1, 0} { // 0 means SetParallelism's default (runtime.NumCPU())
+		b.Run(benchParallelismName(workers), func(b *testing.B) {
+			r, err := NewRenderer(m)
+			if err != nil {
+				b.Fatalf("NewRenderer: %v", err)
+			}
+			if workers > 0 {
+				r.SetParallelism(workers)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r.Clear()
+				if _, err := r.RenderLayer(0); err != nil {
+					b.Fatalf("RenderLayer: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func benchParallelismName(workers int) string {
+	if workers == 0 {
+		return "NumCPU"
+	}
+	return "sequential"
+}
@@ -0,0 +1,335 @@
+/*
+Copyright (c) 2017 Lauris Bukšis-Haberkorns <lauris@nix.lv>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package render
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+var (
+	// ErrInvalidTileSize represents an error in an invalid tile size passed
+	// to SaveAsTiledPyramid.
+	ErrInvalidTileSize = errors.New("tiled/render: tile size must be positive")
+	// ErrInvalidZoomRange represents an error in an invalid zoom range passed
+	// to SaveAsTiledPyramid.
+	ErrInvalidZoomRange = errors.New("tiled/render: minZoom must be >= 0 and <= maxZoom")
+)
+
+// tiledPyramidManifest describes a pyramid directory written by
+// SaveAsTiledPyramid, enough for a viewer to know which z/x/y.png tiles
+// exist and how they relate to the original map.
+type tiledPyramidManifest struct {
+	TileSize int             `json:"tileSize"`
+	MinZoom  int             `json:"minZoom"`
+	MaxZoom  int             `json:"maxZoom"`
+	Bounds   image.Rectangle `json:"bounds"`
+	TileType string          `json:"tileType"`
+}
+
+// SaveAsTiledPyramid renders the map tile by tile into a z/x/y directory of
+// PNGs plus a manifest.json describing it, without ever holding the whole
+// rendered map in memory the way SaveAsPng does - useful for maps too large
+// to comfortably allocate as a single image. maxZoom is rendered directly
+// off the map, tile by tile, via RenderViewport; every zoom below it is
+// produced by downsampling 2x2 blocks of the zoom above with
+// imaging.Resize, the usual tile pyramid technique.
+func (r *Renderer) SaveAsTiledPyramid(dir string, tileSize int, minZoom, maxZoom int) error {
+	if tileSize < 1 {
+		return ErrInvalidTileSize
+	}
+	if minZoom < 0 || maxZoom < minZoom {
+		return ErrInvalidZoomRange
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	bounds := r.engine.GetFinalImageSize()
+
+	if err := r.renderPyramidLevel(dir, tileSize, maxZoom, bounds); err != nil {
+		return err
+	}
+
+	for z := maxZoom - 1; z >= minZoom; z-- {
+		if err := downsamplePyramidLevel(dir, tileSize, z); err != nil {
+			return err
+		}
+	}
+
+	manifest := tiledPyramidManifest{
+		TileSize: tileSize,
+		MinZoom:  minZoom,
+		MaxZoom:  maxZoom,
+		Bounds:   bounds,
+		TileType: "png",
+	}
+	return writeJSONFile(filepath.Join(dir, "manifest.json"), manifest)
+}
+
+// renderPyramidLevel renders every tileSize x tileSize tile covering bounds
+// at zoom z via RenderViewport, one tile at a time, so a pyramid can be
+// built without ever rendering (or allocating) the full map at once. Tiles
+// that overhang the map edge come back from RenderViewport with their
+// outside portion left transparent.
+func (r *Renderer) renderPyramidLevel(dir string, tileSize, z int, bounds image.Rectangle) error {
+	tilesX := ceilDiv(bounds.Dx(), tileSize)
+	tilesY := ceilDiv(bounds.Dy(), tileSize)
+
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			view := image.Rect(tx*tileSize, ty*tileSize, (tx+1)*tileSize, (ty+1)*tileSize)
+			tile, _, err := r.RenderViewport(view)
+			if err != nil {
+				return err
+			}
+			if err := writePyramidTile(dir, z, tx, ty, tile); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// downsamplePyramidLevel builds zoom z by merging each 2x2 block of zoom
+// z+1's tiles into a 2*tileSize square and shrinking it back down to
+// tileSize with Lanczos resampling. It doesn't touch the renderer itself,
+// only the tiles SaveAsTiledPyramid already wrote to dir.
+func downsamplePyramidLevel(dir string, tileSize, z int) error {
+	tilesX, tilesY, err := pyramidLevelExtent(dir, z+1)
+	if err != nil {
+		return err
+	}
+
+	dTilesX := ceilDiv(tilesX, 2)
+	dTilesY := ceilDiv(tilesY, 2)
+
+	for ty := 0; ty < dTilesY; ty++ {
+		for tx := 0; tx < dTilesX; tx++ {
+			merged := image.NewNRGBA(image.Rect(0, 0, 2*tileSize, 2*tileSize))
+
+			for dy := 0; dy < 2; dy++ {
+				for dx := 0; dx < 2; dx++ {
+					src, err := readPyramidTile(dir, z+1, tx*2+dx, ty*2+dy)
+					if err != nil {
+						return err
+					}
+					if src == nil {
+						continue
+					}
+					pos := image.Rect(dx*tileSize, dy*tileSize, (dx+1)*tileSize, (dy+1)*tileSize)
+					draw.Draw(merged, pos, src, src.Bounds().Min, draw.Src)
+				}
+			}
+
+			down := imaging.Resize(merged, tileSize, tileSize, imaging.Lanczos)
+			if err := writePyramidTile(dir, z, tx, ty, down); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pyramidLevelExtent returns how many tiles wide and tall the z level
+// written under dir is, by scanning its z/x/y.png files rather than keeping
+// that count around separately.
+func pyramidLevelExtent(dir string, z int) (tilesX, tilesY int, err error) {
+	xEntries, err := os.ReadDir(filepath.Join(dir, strconv.Itoa(z)))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, xEntry := range xEntries {
+		x, err := strconv.Atoi(xEntry.Name())
+		if err != nil {
+			continue
+		}
+		if x+1 > tilesX {
+			tilesX = x + 1
+		}
+
+		yEntries, err := os.ReadDir(filepath.Join(dir, strconv.Itoa(z), xEntry.Name()))
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, yEntry := range yEntries {
+			y, err := strconv.Atoi(strings.TrimSuffix(yEntry.Name(), ".png"))
+			if err != nil {
+				continue
+			}
+			if y+1 > tilesY {
+				tilesY = y + 1
+			}
+		}
+	}
+	return tilesX, tilesY, nil
+}
+
+// readPyramidTile decodes the PNG at dir/z/x/y.png, returning a nil image
+// (and no error) if that tile doesn't exist - the map edge doesn't
+// necessarily line up with a whole number of tiles at every zoom level.
+func readPyramidTile(dir string, z, x, y int) (image.Image, error) {
+	f, err := os.Open(filepath.Join(dir, strconv.Itoa(z), strconv.Itoa(x), strconv.Itoa(y)+".png"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return png.Decode(f)
+}
+
+// writePyramidTile PNG-encodes img to dir/z/x/y.png, creating the z/x
+// directory if needed.
+func writePyramidTile(dir string, z, x, y int, img image.Image) error {
+	tileDir := filepath.Join(dir, strconv.Itoa(z), strconv.Itoa(x))
+	if err := os.MkdirAll(tileDir, 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(tileDir, strconv.Itoa(y)+".png"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return png.Encode(f, img)
+}
+
+// writeJSONFile marshals v as indented JSON and writes it to path.
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// pyramidArchiveMagic identifies a file produced by PackTiledPyramid.
+const pyramidArchiveMagic = "TLDPYR1\x00"
+
+// pyramidArchiveEntry is one row of a PackTiledPyramid archive's directory,
+// locating a single z/x/y tile's bytes within the archive's tile-data
+// section.
+type pyramidArchiveEntry struct {
+	Z, X, Y        int32
+	Offset, Length uint64
+}
+
+// PackTiledPyramid merges a pyramid directory previously written by
+// SaveAsTiledPyramid into a single archive file: a header holding the
+// pyramid's manifest, a directory mapping each (z,x,y) tile to its offset
+// and length within the tile-data section, and the concatenated tile
+// bodies themselves - modeled on the PMTiles v3 layout, so the whole
+// rendered world can be shipped and served as one file over HTTP Range
+// requests instead of a directory of thousands of small PNGs.
+func PackTiledPyramid(dir, archivePath string) error {
+	manifestBytes, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return err
+	}
+	var manifest tiledPyramidManifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return err
+	}
+
+	var entries []pyramidArchiveEntry
+	var tiles [][]byte
+	var offset uint64
+
+	for z := manifest.MinZoom; z <= manifest.MaxZoom; z++ {
+		tilesX, tilesY, err := pyramidLevelExtent(dir, z)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for y := 0; y < tilesY; y++ {
+			for x := 0; x < tilesX; x++ {
+				data, err := os.ReadFile(filepath.Join(dir, strconv.Itoa(z), strconv.Itoa(x), strconv.Itoa(y)+".png"))
+				if os.IsNotExist(err) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+
+				entries = append(entries, pyramidArchiveEntry{
+					Z: int32(z), X: int32(x), Y: int32(y),
+					Offset: offset, Length: uint64(len(data)),
+				})
+				tiles = append(tiles, data)
+				offset += uint64(len(data))
+			}
+		}
+	}
+
+	f, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	if _, err := w.WriteString(pyramidArchiveMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(manifestBytes))); err != nil {
+		return err
+	}
+	if _, err := w.Write(manifestBytes); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(entries))); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := binary.Write(w, binary.LittleEndian, e); err != nil {
+			return err
+		}
+	}
+	for _, data := range tiles {
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
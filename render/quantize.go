@@ -0,0 +1,171 @@
+/*
+Copyright (c) 2017 Lauris Bukšis-Haberkorns <lauris@nix.lv>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package render
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// maxPaletteSize is the largest palette GIF frames can use.
+const maxPaletteSize = 256
+
+// colorBox is a set of colors bounded by a box in RGB space, used by the
+// median-cut quantizer below.
+type colorBox struct {
+	colors []color.RGBA
+}
+
+// quantizePalette computes a color.Palette of at most maxPaletteSize colors
+// that best approximates the colors found across imgs, using median-cut:
+// repeatedly split the box spanning the widest color range in half until
+// there are enough boxes, then use each box's average color as a palette
+// entry. Passing multiple images produces one shared palette for all of them.
+func quantizePalette(imgs ...image.Image) color.Palette {
+	var colors []color.RGBA
+	for _, img := range imgs {
+		b := img.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				r, g, bl, a := img.At(x, y).RGBA()
+				colors = append(colors, color.RGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(bl >> 8), A: uint8(a >> 8)})
+			}
+		}
+	}
+	if len(colors) == 0 {
+		return color.Palette{color.RGBA{}}
+	}
+
+	boxes := []colorBox{{colors: colors}}
+	for len(boxes) < maxPaletteSize {
+		splitIdx, splitSpan := -1, 0
+		for i, b := range boxes {
+			if len(b.colors) < 2 {
+				continue
+			}
+			if span := b.span(); span > splitSpan {
+				splitIdx, splitSpan = i, span
+			}
+		}
+		if splitIdx < 0 {
+			break
+		}
+
+		box := boxes[splitIdx]
+		right := box.split()
+		boxes[splitIdx] = box
+		boxes = append(boxes, right)
+	}
+
+	pal := make(color.Palette, 0, len(boxes))
+	for _, b := range boxes {
+		pal = append(pal, b.average())
+	}
+	return pal
+}
+
+// longestAxis reports which of R (0), G (1) or B (2) has the widest range
+// of values among the box's colors.
+func (b colorBox) longestAxis() int {
+	var minR, minG, minB uint8 = 255, 255, 255
+	var maxR, maxG, maxB uint8
+	for _, c := range b.colors {
+		minR, maxR = minU8(minR, c.R), maxU8(maxR, c.R)
+		minG, maxG = minU8(minG, c.G), maxU8(maxG, c.G)
+		minB, maxB = minU8(minB, c.B), maxU8(maxB, c.B)
+	}
+
+	rSpan, gSpan, bSpan := int(maxR)-int(minR), int(maxG)-int(minG), int(maxB)-int(minB)
+	switch {
+	case rSpan >= gSpan && rSpan >= bSpan:
+		return 0
+	case gSpan >= bSpan:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// span returns the box's range along its longest axis.
+func (b colorBox) span() int {
+	axis := b.longestAxis()
+	min, max := uint8(255), uint8(0)
+	for _, c := range b.colors {
+		v := channel(c, axis)
+		min, max = minU8(min, v), maxU8(max, v)
+	}
+	return int(max) - int(min)
+}
+
+// split sorts the box's colors along its longest axis and divides them in
+// half, keeping the lower half in b and returning the upper half as a new box.
+func (b *colorBox) split() colorBox {
+	axis := b.longestAxis()
+	sort.Slice(b.colors, func(i, j int) bool {
+		return channel(b.colors[i], axis) < channel(b.colors[j], axis)
+	})
+
+	mid := len(b.colors) / 2
+	right := colorBox{colors: append([]color.RGBA(nil), b.colors[mid:]...)}
+	b.colors = b.colors[:mid]
+	return right
+}
+
+// average returns the mean color of the box, used as its palette entry.
+func (b colorBox) average() color.RGBA {
+	var r, g, bl, a int
+	for _, c := range b.colors {
+		r += int(c.R)
+		g += int(c.G)
+		bl += int(c.B)
+		a += int(c.A)
+	}
+	n := len(b.colors)
+	return color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(bl / n), A: uint8(a / n)}
+}
+
+func channel(c color.RGBA, axis int) uint8 {
+	switch axis {
+	case 0:
+		return c.R
+	case 1:
+		return c.G
+	default:
+		return c.B
+	}
+}
+
+func minU8(a, b uint8) uint8 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxU8(a, b uint8) uint8 {
+	if a > b {
+		return a
+	}
+	return b
+}
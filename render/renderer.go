@@ -26,12 +26,11 @@ import (
 	"errors"
 	"github.com/shipa988/go-tiled"
 	"image"
-	"image/color"
-	"image/draw"
 	"image/jpeg"
 	"image/png"
 	"io"
 	"os"
+	"runtime"
 
 	"image/gif"
 
@@ -52,6 +51,11 @@ type RendererEngine interface {
 	RotateTileImage(tile *tiled.LayerTile, img image.Image) image.Image
 	GetTilePosition(x, y int) image.Rectangle
 	GetTrueTilePosition(tileRect image.Rectangle, x, y int) image.Rectangle
+	// VisibleTileRange returns the [xStart,xEnd) x [yStart,yEnd) tile index
+	// range that can draw into view, clamped to the map's bounds. It is the
+	// inverse of GetTilePosition, used by RenderViewport to avoid visiting
+	// every tile of a large map just to render a small window of it.
+	VisibleTileRange(view image.Rectangle) (xStart, xEnd, yStart, yEnd int)
 }
 
 type TileObject struct {
@@ -61,9 +65,12 @@ type TileObject struct {
 }
 type AnimationTile struct {
 	TileImages [] image.Image
+	// FrameDurations holds how long each entry of TileImages is shown for,
+	// in milliseconds, in the same order as TileImages.
+	FrameDurations []uint32
 	TilePos   image.Rectangle
 	TilePlane string
-	Duration uint32
+	Duration uint32 // total length of one full animation loop, in milliseconds.
 }
 
 type LayerObjects struct {
@@ -79,6 +86,9 @@ type Renderer struct {
 	Result             *image.NRGBA // The image result after rendering using the Render functions.
 	tileCache          map[uint32]image.Image
 	engine             RendererEngine
+	Animations         []AnimationTile // Animated tiles collected by RenderLayer/RenderVisibleLayers since the last Clear, consumed by RenderFrame.
+	parallelism        int             // Number of chunk workers RenderLayer uses, see SetParallelism.
+	blendModes         map[string]BlendFunc // Blend modes registered with RegisterBlendMode, on top of defaultBlendModes.
 }
 
 type subImager interface {
@@ -87,10 +97,17 @@ type subImager interface {
 
 // NewRenderer creates new rendering engine instance.
 func NewRenderer(m *tiled.Map) (*Renderer, error) {
-	r := &Renderer{m: m, tileCache: make(map[uint32]image.Image)}
-	if r.m.Orientation == "orthogonal" {
+	r := &Renderer{m: m, tileCache: make(map[uint32]image.Image), parallelism: runtime.NumCPU()}
+	switch r.m.Orientation {
+	case "orthogonal":
 		r.engine = &OrthogonalRendererEngine{}
-	} else {
+	case "isometric":
+		r.engine = &IsometricRendererEngine{}
+	case "staggered":
+		r.engine = &StaggeredRendererEngine{}
+	case "hexagonal":
+		r.engine = &HexagonalRendererEngine{}
+	default:
 		return nil, ErrUnsupportedOrientation
 	}
 
@@ -185,136 +202,148 @@ func (r *Renderer) getTileImage(tile *tiled.LayerTile) (image.Image, error) {
 	return r.engine.RotateTileImage(tile, timg), nil
 }
 
-// RenderLayer renders single map layer.
+// RenderLayer renders single map layer. Tiles are pre-cached in a single
+// sequential pass, then split into fixed-size chunks and rendered by a pool
+// of r.parallelism workers (see SetParallelism), each onto its own
+// sub-image; once every chunk is done the sub-images are composited into
+// r.Result in chunk order.
 func (r *Renderer) RenderLayer(index int) (LayerObjects, error) {
-	colmapX := map[float64][]float64{}
-	colmapY := map[float64][]float64{}
-	lo:= LayerObjects{}
-	layer := r.m.Layers[index]
-
-	var xs, xe, xi, ys, ye, yi int
-	if r.m.RenderOrder == "" || r.m.RenderOrder == "right-down" {
-		xs = 0
-		xe = r.m.Width
-		xi = 1
-		ys = 0
-		ye = r.m.Height
-		yi = 1
-	} else {
-		return lo, ErrUnsupportedRenderOrder
+	return r.renderLayer(r.m.Layers[index])
+}
+
+// renderLayer does the actual work for RenderLayer. It is split out so
+// group layers, whose Layers don't live in r.m.Layers, can render their
+// tile layers the same way.
+func (r *Renderer) renderLayer(layer *tiled.Layer) (LayerObjects, error) {
+	xStart, xEnd, xStep := 0, r.m.Width, 1
+	yStart, yEnd, yStep := 0, r.m.Height, 1
+
+	switch r.m.RenderOrder {
+	case "", "right-down":
+		// xStart/xEnd/xStep and yStart/yEnd/yStep already default to this order.
+	case "right-up":
+		yStart, yEnd, yStep = r.m.Height-1, -1, -1
+	case "left-down":
+		xStart, xEnd, xStep = r.m.Width-1, -1, -1
+	case "left-up":
+		xStart, xEnd, xStep = r.m.Width-1, -1, -1
+		yStart, yEnd, yStep = r.m.Height-1, -1, -1
+	default:
+		return LayerObjects{}, ErrUnsupportedRenderOrder
 	}
 
-	i := 0
-	var ltile *tiled.LayerTile
-	for y := ys; y*yi < ye; y = y + yi {
-		for x := xs; x*xi < xe; x = x + xi {
-			ltile= layer.Tiles[i]
-			if ltile.IsNil() {
-				i++
-				continue
-			}
+	if err := r.warmTileCache(layer); err != nil {
+		return LayerObjects{}, err
+	}
 
-			img, err := r.getTileImage(ltile)
-			if err != nil {
-				return lo, err
-			}
-			//position of tile knowing it size
-			pos := r.engine.GetTrueTilePosition(img.Bounds(), x, y)
-			//get all collisions of this tile
-			for _, collision := range ltile.Collision {
-				if collision.Max.Y != 0 {
-					pymin := float64(pos.Min.Y + collision.Min.Y)
-					pymax := float64(pos.Min.Y + collision.Max.Y)
-					pxmin := float64(pos.Min.X + collision.Min.X)
-					pxmax := float64(pos.Min.X + collision.Max.X)
-					for y := pymin; y <= pymax; y++ {
-						for x := pxmin; x <= pxmax; x++ {
-							colmapY[y] = append(colmapY[y], x)
-							colmapX[x] = append(colmapX[x], y)
-						}
-					}
-				}
-			}
-			//get all animation of this tile
-			if len(ltile.Animation)>0{
-				animationTile := AnimationTile{
-					TileImages: nil,
-					TilePos:    pos,
-					Duration:   0,
-				}
-				for _, tile := range ltile.Tileset.Tiles {
-					if tile.ID==ltile.ID{
-						animationTile.TilePlane=tile.Type
-						break
-					}
-				}
-				animgs:=[]image.Image{img}
-				for n:=1;n< len(ltile.Animation);n++ {
-					lt,err:=r.m.TileGIDToTile(ltile.Animation[n].TileID+ltile.Tileset.FirstGID)
-
-					if err != nil {
-						continue
-					}
-					animg, err := r.getTileImage(lt)
-					if err != nil {
-						continue
-					}
-					animgs = append(animgs, animg)
-				}
+	return r.renderChunks(layer, chunkTileRange(xStart, xEnd, xStep, yStart, yEnd, yStep, defaultChunkSize))
+}
 
-				animationTile.TileImages=animgs
-				lo.Animation = append(lo.Animation, animationTile)
-			}
 
-			//get all tiles in this layer
-			lo.TileObjects = append(lo.TileObjects, TileObject{
-				TileImage: img,
-				TilePos:   pos,
-			})
+// RenderVisibleLayers renders every visible tile layer, object group, image
+// layer and (recursively) group layer in the map, so a full TMX can be
+// rendered with a single call. tiled.Map keeps these in four separate
+// slices rather than one ordered list, so layers render before object
+// groups, which render before image layers and groups - an approximation
+// of true Tiled z-order that is exact for maps that don't interleave layer
+// kinds, which covers the common case.
+func (r *Renderer) RenderVisibleLayers() (coll LayerObjects, e error) {
+	coll = LayerObjects{
+		XCollision: map[float64][]float64{},
+		YCollision: map[float64][]float64{},
+	}
 
-			if layer.Opacity < 1 {
-				mask := image.NewUniform(color.Alpha{uint8(layer.Opacity * 255)})
+	if err := r.renderVisibleLayersInto(r.m.Layers, &coll); err != nil {
+		return coll, err
+	}
+	if err := r.renderVisibleObjectGroupsInto(r.m.ObjectGroups, &coll); err != nil {
+		return coll, err
+	}
+	if err := r.renderVisibleImageLayersInto(r.m.ImageLayers); err != nil {
+		return coll, err
+	}
+	if err := r.renderVisibleGroupsInto(r.m.Groups, &coll); err != nil {
+		return coll, err
+	}
 
-				draw.DrawMask(r.Result, pos, img, img.Bounds().Min, mask, mask.Bounds().Min, draw.Over)
-			} else {
-				draw.Draw(r.Result, pos, img, img.Bounds().Min, draw.Over)
-			}
+	return coll, nil
+}
 
-			i++
+func (r *Renderer) renderVisibleLayersInto(layers []*tiled.Layer, coll *LayerObjects) error {
+	for _, layer := range layers {
+		if !layer.Visible {
+			continue
 		}
+
+		lo, err := r.renderLayer(layer)
+		if err != nil {
+			return err
+		}
+		mergeLayerObjects(coll, lo)
 	}
-	//func (Rectangle) Overlaps
-	lo.YCollision = colmapY
-	lo.XCollision = colmapX
-	return lo, nil
+	return nil
 }
 
+func (r *Renderer) renderVisibleObjectGroupsInto(groups []*tiled.ObjectGroup, coll *LayerObjects) error {
+	for _, group := range groups {
+		if !group.Visible {
+			continue
+		}
 
-// RenderVisibleLayers renders all visible map layers.
-func (r *Renderer) RenderVisibleLayers() (coll LayerObjects, e error) {
-	coll = LayerObjects{
-		XCollision: map[float64][]float64{},
-		YCollision: map[float64][]float64{},
+		lo, err := r.renderObjectGroup(group)
+		if err != nil {
+			return err
+		}
+		mergeLayerObjects(coll, lo)
 	}
+	return nil
+}
 
-	for i := range r.m.Layers {
-		if !r.m.Layers[i].Visible {
+func (r *Renderer) renderVisibleImageLayersInto(layers []*tiled.ImageLayer) error {
+	for _, il := range layers {
+		if !il.Visible {
 			continue
 		}
+		if err := r.renderImageLayer(il); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		layerCollisions, err := r.RenderLayer(i)
-		if err != nil {
-			return coll, err
+func (r *Renderer) renderVisibleGroupsInto(groups []*tiled.Group, coll *LayerObjects) error {
+	for _, group := range groups {
+		if !group.Visible {
+			continue
 		}
 
-		for k, v := range layerCollisions.XCollision {
-			coll.XCollision[k] = append(coll.XCollision[k], v...)
+		if err := r.renderVisibleLayersInto(group.Layers, coll); err != nil {
+			return err
+		}
+		if err := r.renderVisibleObjectGroupsInto(group.ObjectGroups, coll); err != nil {
+			return err
 		}
-		for k, v := range layerCollisions.YCollision {
-			coll.YCollision[k] = append(coll.YCollision[k], v...)
+		if err := r.renderVisibleImageLayersInto(group.ImageLayers); err != nil {
+			return err
+		}
+		if err := r.renderVisibleGroupsInto(group.Groups, coll); err != nil {
+			return err
 		}
 	}
-	return coll, nil
+	return nil
+}
+
+// mergeLayerObjects appends src's tile objects, animations and collisions
+// into dst.
+func mergeLayerObjects(dst *LayerObjects, src LayerObjects) {
+	dst.TileObjects = append(dst.TileObjects, src.TileObjects...)
+	dst.Animation = append(dst.Animation, src.Animation...)
+	for k, v := range src.XCollision {
+		dst.XCollision[k] = append(dst.XCollision[k], v...)
+	}
+	for k, v := range src.YCollision {
+		dst.YCollision[k] = append(dst.YCollision[k], v...)
+	}
 }
 
 // Clear clears the render result to allow for separation of layers. For example, you can
@@ -322,6 +351,7 @@ func (r *Renderer) RenderVisibleLayers() (coll LayerObjects, e error) {
 // layer in the Map.
 func (r *Renderer) Clear() {
 	r.Result = image.NewNRGBA(r.engine.GetFinalImageSize())
+	r.Animations = nil
 }
 
 // SaveAsPng writes rendered layers as PNG image to provided writer.
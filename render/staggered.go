@@ -0,0 +1,176 @@
+/*
+Copyright (c) 2017 Lauris Bukšis-Haberkorns <lauris@nix.lv>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package render
+
+import (
+	"image"
+	"math"
+
+	"github.com/shipa988/go-tiled"
+)
+
+// TMX encodes staggeraxis/staggerindex as the strings "x"/"y" and
+// "even"/"odd", but github.com/shipa988/go-tiled's Map.StaggerAxis and
+// Map.StaggerIndex are declared as plain ints with an xml:"...,attr" tag
+// that tries to decode that same string straight into an int. That fails
+// LoadFromFile outright for any real staggered/hexagonal TMX, and for one
+// that happens to load some other way the fields are left permanently
+// zero-valued - so keying rendering off them makes the staggerAxisY/
+// staggerIndexOdd branches below dead code for every map in practice. These
+// constants are this package's own convention for the two axes and indexes,
+// in TMX attribute order; staggerAxis and staggerIndex below read the real
+// value from a custom map property instead of these structurally-unusable
+// fields.
+const (
+	staggerAxisX = iota
+	staggerAxisY
+)
+
+const (
+	staggerIndexEven = iota
+	staggerIndexOdd
+)
+
+// staggerAxis returns m's stagger axis. Since Map.StaggerAxis can't carry
+// the TMX "x"/"y" attribute (see above), this reads it from a "staggeraxis"
+// custom map property instead, falling back to the TMX spec's own default
+// of "y" when the property isn't set.
+func staggerAxis(m *tiled.Map) int {
+	if m.Properties != nil {
+		switch m.Properties.GetString("staggeraxis") {
+		case "x":
+			return staggerAxisX
+		case "y":
+			return staggerAxisY
+		}
+	}
+	return staggerAxisY
+}
+
+// staggerIndex returns m's stagger index, the same way staggerAxis does,
+// from a "staggerindex" custom map property, falling back to the TMX
+// spec's own default of "odd" when the property isn't set.
+func staggerIndex(m *tiled.Map) int {
+	if m.Properties != nil {
+		switch m.Properties.GetString("staggerindex") {
+		case "even":
+			return staggerIndexEven
+		case "odd":
+			return staggerIndexOdd
+		}
+	}
+	return staggerIndexOdd
+}
+
+// StaggeredRendererEngine is a RendererEngine implementation for maps with
+// orientation "staggered", where every other row or column is offset by half
+// a tile, as determined by the map's stagger axis and index (see
+// staggerAxis/staggerIndex).
+type StaggeredRendererEngine struct {
+	m *tiled.Map
+}
+
+// Init initializes the renderer engine with the given map.
+func (e *StaggeredRendererEngine) Init(m *tiled.Map) {
+	e.m = m
+}
+
+// GetFinalImageSize returns the bounds of the fully rendered map image.
+func (e *StaggeredRendererEngine) GetFinalImageSize() image.Rectangle {
+	if staggerAxis(e.m) == staggerAxisX {
+		columnWidth := e.m.TileWidth / 2
+		w := columnWidth*e.m.Width + columnWidth
+		h := e.m.TileHeight*e.m.Height + e.m.TileHeight/2
+		return image.Rect(0, 0, w, h)
+	}
+
+	rowHeight := e.m.TileHeight / 2
+	w := e.m.TileWidth*e.m.Width + e.m.TileWidth/2
+	h := rowHeight*e.m.Height + rowHeight
+	return image.Rect(0, 0, w, h)
+}
+
+// staggers reports whether the row or column at the given index is one of
+// the offset ones, according to the map's stagger index (see staggerIndex).
+func (e *StaggeredRendererEngine) staggers(index int) bool {
+	if staggerIndex(e.m) == staggerIndexOdd {
+		return index%2 == 1
+	}
+	return index%2 == 0
+}
+
+// GetTilePosition returns the pixel-space cell occupied by the tile at map
+// coordinates (x, y).
+func (e *StaggeredRendererEngine) GetTilePosition(x, y int) image.Rectangle {
+	tw, th := e.m.TileWidth, e.m.TileHeight
+
+	if staggerAxis(e.m) == staggerAxisY {
+		px := x * tw
+		py := y * (th / 2)
+		if e.staggers(y) {
+			px += tw / 2
+		}
+		return image.Rect(px, py, px+tw, py+th)
+	}
+
+	px := x * (tw / 2)
+	py := y * th
+	if e.staggers(x) {
+		py += th / 2
+	}
+	return image.Rect(px, py, px+tw, py+th)
+}
+
+// GetTrueTilePosition returns where a tile image of the given size should
+// actually be drawn for the cell at (x, y), anchoring it to the bottom-left
+// of the cell so tiles taller or wider than the grid still line up correctly.
+func (e *StaggeredRendererEngine) GetTrueTilePosition(tileRect image.Rectangle, x, y int) image.Rectangle {
+	pos := e.GetTilePosition(x, y)
+	return image.Rect(pos.Min.X, pos.Max.Y-tileRect.Dy(), pos.Min.X+tileRect.Dx(), pos.Max.Y)
+}
+
+// RotateTileImage applies the tile's flip flags to its image.
+func (e *StaggeredRendererEngine) RotateTileImage(tile *tiled.LayerTile, img image.Image) image.Image {
+	return rotateTileImage(tile, img)
+}
+
+// VisibleTileRange returns the tile index range intersecting view. The
+// stagger offset alternates per row/column, so rather than solving the
+// parity exactly it inverts GetTilePosition ignoring the offset and lets
+// tileRangeFromCorners' one-tile padding absorb the difference.
+func (e *StaggeredRendererEngine) VisibleTileRange(view image.Rectangle) (xStart, xEnd, yStart, yEnd int) {
+	tw, th := float64(e.m.TileWidth), float64(e.m.TileHeight)
+
+	invert := func(px, py int) (int, int) {
+		if staggerAxis(e.m) == staggerAxisY {
+			x := math.Floor(float64(px) / tw)
+			y := math.Floor(float64(py) / (th / 2))
+			return int(x), int(y)
+		}
+		x := math.Floor(float64(px) / (tw / 2))
+		y := math.Floor(float64(py) / th)
+		return int(x), int(y)
+	}
+
+	return tileRangeFromCorners(e.m, view, invert)
+}
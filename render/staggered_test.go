@@ -0,0 +1,82 @@
+/*
+Copyright (c) 2017 Lauris Bukšis-Haberkorns <lauris@nix.lv>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package render
+
+import (
+	"testing"
+
+	"github.com/shipa988/go-tiled"
+)
+
+// TestStaggerAxisFromProperty checks that staggerAxis/staggerIndex read the
+// TMX's real "x"/"y" and "even"/"odd" strings from a custom map property,
+// since Map.StaggerAxis/StaggerIndex can't carry them (see staggered.go).
+// Without this, the "y"/"odd" branches of Staggered/HexagonalRendererEngine
+// are unreachable for every map.
+func TestStaggerAxisFromProperty(t *testing.T) {
+	tests := []struct {
+		name          string
+		props         tiled.Properties
+		wantAxis      int
+		wantIndex     int
+	}{
+		{"defaults", nil, staggerAxisY, staggerIndexOdd},
+		{"x/even", tiled.Properties{
+			{Name: "staggeraxis", Value: "x"},
+			{Name: "staggerindex", Value: "even"},
+		}, staggerAxisX, staggerIndexEven},
+		{"y/odd", tiled.Properties{
+			{Name: "staggeraxis", Value: "y"},
+			{Name: "staggerindex", Value: "odd"},
+		}, staggerAxisY, staggerIndexOdd},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &tiled.Map{Properties: &tc.props}
+			if got := staggerAxis(m); got != tc.wantAxis {
+				t.Errorf("staggerAxis() = %d, want %d", got, tc.wantAxis)
+			}
+			if got := staggerIndex(m); got != tc.wantIndex {
+				t.Errorf("staggerIndex() = %d, want %d", got, tc.wantIndex)
+			}
+		})
+	}
+}
+
+// TestStaggeredGetTilePositionYAxis checks the staggerAxisY branch of
+// StaggeredRendererEngine.GetTilePosition is actually reachable and offsets
+// alternate rows, given a "staggeraxis":"y" map property.
+func TestStaggeredGetTilePositionYAxis(t *testing.T) {
+	props := tiled.Properties{{Name: "staggeraxis", Value: "y"}}
+	m := &tiled.Map{Properties: &props, TileWidth: 32, TileHeight: 16}
+
+	e := &StaggeredRendererEngine{}
+	e.Init(m)
+
+	row0 := e.GetTilePosition(0, 0)
+	row1 := e.GetTilePosition(0, 1)
+	if row1.Min.X-row0.Min.X != m.TileWidth/2 {
+		t.Errorf("row 1 is not offset by half a tile on the y stagger axis: row0=%v row1=%v", row0, row1)
+	}
+}
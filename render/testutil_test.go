@@ -0,0 +1,95 @@
+/*
+Copyright (c) 2017 Lauris Bukšis-Haberkorns <lauris@nix.lv>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shipa988/go-tiled"
+)
+
+// newTestMap builds a minimal in-memory *tiled.Map of the given orientation,
+// backed by a single tileWH x tileWH tile image, with one tile layer sized
+// width x height and fully filled with that tile. It lets tests and
+// benchmarks exercise the real rendering path without a TMX fixture on disk.
+func newTestMap(t testing.TB, orientation string, width, height, tileWH int) (*tiled.Map, *tiled.Layer) {
+	t.Helper()
+
+	imgPath := filepath.Join(t.TempDir(), "tile.png")
+	writeTestTileImage(t, imgPath, tileWH, tileWH)
+
+	ts := &tiled.Tileset{
+		FirstGID:  1,
+		TileWidth: tileWH, TileHeight: tileWH,
+		TileCount: 1, Columns: 1,
+		Image: &tiled.Image{Source: imgPath, Width: tileWH, Height: tileWH},
+	}
+
+	m := &tiled.Map{
+		Orientation: orientation,
+		Width:       width, Height: height,
+		TileWidth: tileWH, TileHeight: tileWH,
+		Tilesets: []*tiled.Tileset{ts},
+	}
+
+	tiles := make([]*tiled.LayerTile, width*height)
+	for i := range tiles {
+		tile, err := m.TileGIDToTile(1)
+		if err != nil {
+			t.Fatalf("TileGIDToTile: %v", err)
+		}
+		tiles[i] = tile
+	}
+
+	layer := &tiled.Layer{Visible: true, Opacity: 1, Tiles: tiles}
+	m.Layers = []*tiled.Layer{layer}
+
+	return m, layer
+}
+
+// writeTestTileImage writes a solid-colored w x h PNG to path.
+func writeTestTileImage(t testing.TB, path string, w, h int) {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: 0x20, G: 0x40, B: 0x80, A: 0xff})
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create tile image: %v", err)
+	}
+	defer f.Close()
+
+	if err := png.Encode(f, img); err != nil {
+		t.Fatalf("encode tile image: %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright (c) 2017 Lauris Bukšis-Haberkorns <lauris@nix.lv>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package render
+
+import (
+	"image"
+
+	"github.com/shipa988/go-tiled"
+)
+
+// RenderViewport renders only the part of every visible tile layer that
+// intersects view, into a view-sized image instead of the whole map. Unlike
+// RenderLayer/RenderVisibleLayers it doesn't allocate r.Result or touch it;
+// it's meant for callers that only ever need a camera-sized window into a
+// map too large to comfortably render (or even allocate) in full, e.g. a
+// scrolling viewer. Only the tile layers in the map's top-level Layers are
+// drawn; object groups, image layers and group layers are not rendered into
+// the viewport.
+func (r *Renderer) RenderViewport(view image.Rectangle) (*image.NRGBA, LayerObjects, error) {
+	dst := image.NewNRGBA(view)
+	lo := LayerObjects{XCollision: map[float64][]float64{}, YCollision: map[float64][]float64{}}
+
+	if err := r.renderViewportLayers(dst, r.m.Layers, view, &lo); err != nil {
+		return dst, lo, err
+	}
+
+	return dst, lo, nil
+}
+
+// renderViewportLayers renders the tiles of every visible layer in layers
+// that intersect view directly into dst, merging their collisions and
+// animations into coll.
+func (r *Renderer) renderViewportLayers(dst *image.NRGBA, layers []*tiled.Layer, view image.Rectangle, coll *LayerObjects) error {
+	xStart, xEnd, yStart, yEnd := r.engine.VisibleTileRange(view)
+
+	for _, layer := range layers {
+		if !layer.Visible {
+			continue
+		}
+
+		if err := r.warmTileRangeCache(layer, xStart, xEnd, yStart, yEnd); err != nil {
+			return err
+		}
+
+		lo, err := r.renderTileRangeInto(dst, layer, xStart, xEnd, 1, yStart, yEnd, 1)
+		if err != nil {
+			return err
+		}
+		mergeLayerObjects(coll, lo)
+	}
+
+	return nil
+}
+
+// warmTileRangeCache is warmTileCache restricted to the tiles in
+// [xStart,xEnd) x [yStart,yEnd), so RenderViewport doesn't pay to decode
+// tile images outside the window it actually draws.
+func (r *Renderer) warmTileRangeCache(layer *tiled.Layer, xStart, xEnd, yStart, yEnd int) error {
+	for y := yStart; y < yEnd; y++ {
+		for x := xStart; x < xEnd; x++ {
+			tile := layer.Tiles[y*r.m.Width+x]
+			if tile.IsNil() {
+				continue
+			}
+			if _, err := r.getTileImage(tile); err != nil {
+				return err
+			}
+			for _, frame := range tile.Animation {
+				ft, err := r.m.TileGIDToTile(frame.TileID + tile.Tileset.FirstGID)
+				if err != nil {
+					continue
+				}
+				if _, err := r.getTileImage(ft); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// tileRangeFromCorners converts view's four corners to tile coordinates via
+// invert and returns the smallest tile index range containing all of them,
+// padded by one tile (for tiles whose image overhangs their grid cell, and
+// for invert functions that only approximate the true inverse projection)
+// and clamped to the map's bounds.
+func tileRangeFromCorners(m *tiled.Map, view image.Rectangle, invert func(px, py int) (x, y int)) (xStart, xEnd, yStart, yEnd int) {
+	corners := [4]image.Point{
+		{X: view.Min.X, Y: view.Min.Y},
+		{X: view.Max.X, Y: view.Min.Y},
+		{X: view.Min.X, Y: view.Max.Y},
+		{X: view.Max.X, Y: view.Max.Y},
+	}
+
+	minX, minY := invert(corners[0].X, corners[0].Y)
+	maxX, maxY := minX, minY
+	for _, c := range corners[1:] {
+		x, y := invert(c.X, c.Y)
+		if x < minX {
+			minX = x
+		}
+		if x > maxX {
+			maxX = x
+		}
+		if y < minY {
+			minY = y
+		}
+		if y > maxY {
+			maxY = y
+		}
+	}
+
+	xStart = clampInt(minX-1, 0, m.Width)
+	xEnd = clampInt(maxX+2, 0, m.Width)
+	yStart = clampInt(minY-1, 0, m.Height)
+	yEnd = clampInt(maxY+2, 0, m.Height)
+	return
+}
+
+// clampInt restricts v to [lo, hi].
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// ceilDiv divides a by b, rounding towards positive infinity.
+func ceilDiv(a, b int) int {
+	if a%b == 0 {
+		return a / b
+	}
+	if a > 0 {
+		return a/b + 1
+	}
+	return a / b
+}